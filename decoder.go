@@ -2,11 +2,15 @@ package decoder
 
 import (
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"strconv"
+	"sync"
 	"time"
 	"unicode/utf8"
 
@@ -16,6 +20,16 @@ import (
 	"github.com/negbie/sipparser"
 )
 
+// maxDecompressedPayload caps the output of a decompressed CompressedPayload
+// chunk so a malformed or malicious agent can't zip-bomb us into exhausting
+// memory.
+const maxDecompressedPayload = 65536
+
+// compressBufPool reuses the scratch buffers used to (de)compress payloads.
+var compressBufPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
 // The first 4 bytes are the string "HEP3". The next 2 bytes are the length of the
 // whole message (len("HEP3") + length of all the chucks we have. The next bytes
 // are all the chuncks created by makeChuncks()
@@ -186,6 +200,11 @@ func (h *HEP) parseHEP(packet []byte) error {
 			}
 		case CompressedPayload:
 			h.CompressedPayload = string(chunkBody)
+			payload, err := decompressPayload(chunkBody)
+			if err != nil {
+				return err
+			}
+			h.Payload = payload
 		case CorrelationID:
 			h.CorrelationID = string(chunkBody)
 		case Vlan:
@@ -197,6 +216,53 @@ func (h *HEP) parseHEP(packet []byte) error {
 	return nil
 }
 
+// decompressPayload inflates a CompressedPayload chunk body, trying gzip
+// first and falling back to raw deflate, and caps the result at
+// maxDecompressedPayload to guard against decompression bombs.
+func decompressPayload(data []byte) (string, error) {
+	var zr io.ReadCloser
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err == nil {
+		zr = gr
+	} else {
+		zr = flate.NewReader(bytes.NewReader(data))
+	}
+	defer zr.Close()
+
+	buf := compressBufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer compressBufPool.Put(buf)
+
+	// Read one byte past the cap so a genuine decompression bomb can be
+	// told apart from a stream that legitimately ends at exactly
+	// maxDecompressedPayload bytes.
+	n, err := io.Copy(buf, io.LimitReader(zr, maxDecompressedPayload+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress hep CompressedPayload chunk: %v", err)
+	}
+	if n > maxDecompressedPayload {
+		return "", fmt.Errorf("hep CompressedPayload chunk exceeds %d bytes decompressed", maxDecompressedPayload)
+	}
+
+	return buf.String(), nil
+}
+
+// compressPayload gzips payload for agents/servers that opt into sending
+// the CompressedPayload chunk instead of the plain Payload chunk.
+func compressPayload(payload string) []byte {
+	buf := compressBufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer compressBufPool.Put(buf)
+
+	gw := gzip.NewWriter(buf)
+	gw.Write([]byte(payload))
+	gw.Close()
+
+	out := make([]byte, buf.Len())
+	copy(out, buf.Bytes())
+	return out
+}
+
 func (h *HEP) parseSIP() error {
 	h.SIP = sipparser.ParseMsg(h.Payload)
 
@@ -316,14 +382,22 @@ func makeChuncks(h *HEP, w *bytes.Buffer) []byte {
 	w.Write(hepLen)
 	w.Write([]byte(h.NodePW))
 
-	// Chunk captured packet payload
-	w.Write([]byte{0x00, 0x00, 0x00, 0x0f})
-	binary.BigEndian.PutUint16(hepLen, 6+uint16(len(h.Payload)))
-	w.Write(hepLen)
-	w.Write([]byte(h.Payload))
-
-	// Chunk captured compressed payload (gzip/inflate)
-	//w.Write([]byte{0x00,0x00, 0x00,0x10})
+	// Chunk captured packet payload. If CompressPayloadThreshold is set
+	// (> 0) and the payload is longer than that threshold we gzip it into
+	// a CompressedPayload chunk instead, which the receiving side inflates
+	// transparently in parseHEP.
+	if threshold := config.Setting.CompressPayloadThreshold; threshold > 0 && len(h.Payload) > threshold {
+		compressed := compressPayload(h.Payload)
+		w.Write([]byte{0x00, 0x00, 0x00, 0x10})
+		binary.BigEndian.PutUint16(hepLen, 6+uint16(len(compressed)))
+		w.Write(hepLen)
+		w.Write(compressed)
+	} else {
+		w.Write([]byte{0x00, 0x00, 0x00, 0x0f})
+		binary.BigEndian.PutUint16(hepLen, 6+uint16(len(h.Payload)))
+		w.Write(hepLen)
+		w.Write([]byte(h.Payload))
+	}
 
 	if h.CorrelationID != "" {
 		// Chunk internal correlation id
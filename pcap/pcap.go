@@ -0,0 +1,143 @@
+package pcap
+
+import (
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+
+	"github.com/negbie/heplify-server"
+	"github.com/negbie/heplify-server/config"
+	"github.com/negbie/heplify-server/logp"
+)
+
+type PCAPInput struct {
+	file   string
+	iface  string
+	filter string
+	speed  float64
+	stop   bool
+
+	Chan chan []byte
+}
+
+func New() *PCAPInput {
+	return &PCAPInput{
+		file:   config.Setting.PCAPFile,
+		iface:  config.Setting.PCAPIface,
+		filter: config.Setting.PCAPFilter,
+		speed:  config.Setting.PCAPReplaySpeed,
+	}
+}
+
+func (p *PCAPInput) Run() error {
+	handle, err := p.open()
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+
+	logp.Info("pcap input file: %s, iface: %s, filter: %s\n", p.file, p.iface, p.filter)
+
+	source := gopacket.NewPacketSource(handle, handle.LinkType())
+	var lastTs time.Time
+
+	for packet := range source.Packets() {
+		if p.stop {
+			break
+		}
+
+		hep, ts, ok := toHEP(packet)
+		if !ok {
+			continue
+		}
+
+		if p.speed > 0 && !lastTs.IsZero() {
+			if wait := ts.Sub(lastTs); wait > 0 {
+				time.Sleep(time.Duration(float64(wait) / p.speed))
+			}
+		}
+		lastTs = ts
+
+		p.Chan <- decoder.EncodeHEP(hep)
+	}
+
+	return nil
+}
+
+func (p *PCAPInput) End() {
+	p.stop = true
+}
+
+func (p *PCAPInput) open() (*pcap.Handle, error) {
+	var (
+		handle *pcap.Handle
+		err    error
+	)
+
+	if p.file != "" {
+		handle, err = pcap.OpenOffline(p.file)
+	} else {
+		handle, err = pcap.OpenLive(p.iface, 65536, true, pcap.BlockForever)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p.filter != "" {
+		if err := handle.SetBPFFilter(p.filter); err != nil {
+			handle.Close()
+			return nil, err
+		}
+	}
+	return handle, nil
+}
+
+func toHEP(packet gopacket.Packet) (*decoder.HEP, time.Time, bool) {
+	ipLayer := packet.Layer(layers.LayerTypeIPv4)
+	if ipLayer == nil {
+		return nil, time.Time{}, false
+	}
+	ip4, _ := ipLayer.(*layers.IPv4)
+
+	var (
+		srcPort, dstPort uint16
+		protocol         byte
+		payload          []byte
+	)
+
+	if udpLayer := packet.Layer(layers.LayerTypeUDP); udpLayer != nil {
+		udp, _ := udpLayer.(*layers.UDP)
+		srcPort, dstPort = uint16(udp.SrcPort), uint16(udp.DstPort)
+		protocol = 0x11
+		payload = udp.Payload
+	} else if tcpLayer := packet.Layer(layers.LayerTypeTCP); tcpLayer != nil {
+		tcp, _ := tcpLayer.(*layers.TCP)
+		srcPort, dstPort = uint16(tcp.SrcPort), uint16(tcp.DstPort)
+		protocol = 0x06
+		payload = tcp.Payload
+	} else {
+		return nil, time.Time{}, false
+	}
+
+	if len(payload) == 0 {
+		return nil, time.Time{}, false
+	}
+
+	ts := packet.Metadata().Timestamp
+
+	hep := &decoder.HEP{
+		Version:   0x02,
+		Protocol:  protocol,
+		SrcIP:     ip4.SrcIP,
+		DstIP:     ip4.DstIP,
+		SrcPort:   srcPort,
+		DstPort:   dstPort,
+		Tsec:      uint32(ts.Unix()),
+		Tmsec:     uint32(ts.Nanosecond() / 1000),
+		ProtoType: 1,
+		Payload:   string(payload),
+	}
+	return hep, ts, true
+}
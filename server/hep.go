@@ -3,6 +3,7 @@ package input
 import (
 	"bytes"
 	"net"
+	"os"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -13,15 +14,25 @@ import (
 	"github.com/negbie/heplify-server/database"
 	"github.com/negbie/heplify-server/logp"
 	"github.com/negbie/heplify-server/metric"
+	"github.com/negbie/heplify-server/pcap"
 	"github.com/negbie/heplify-server/queue"
 )
 
 type HEPInput struct {
-	addr    string
-	pool    chan chan struct{}
-	stats   HEPStats
-	stop    bool
-	workers int
+	addr        string
+	pool        chan chan struct{}
+	stats       HEPStats
+	stop        bool
+	workers     int
+	batchSize   int
+	sockets     int
+	socketStats []socketStat
+	tcpListener net.Listener
+	tlsListener net.Listener
+	unixConn    *net.UnixConn
+	pcapInput   *pcap.PCAPInput
+	connMu      sync.Mutex
+	conns       map[net.Conn]struct{}
 }
 
 type HEPStats struct {
@@ -31,6 +42,11 @@ type HEPStats struct {
 	PktCount uint64
 }
 
+type socketStat struct {
+	id       int
+	pktCount uint64
+}
+
 var (
 	inCh  = make(chan []byte, 10000)
 	dbCh  = make(chan *decoder.HEP, 10000)
@@ -48,24 +64,38 @@ var (
 )
 
 func NewHEP() *HEPInput {
+	batchSize := config.Setting.HEPBatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	sockets := config.Setting.HEPSockets
+	if sockets < 1 {
+		sockets = 1
+	}
+
 	return &HEPInput{
-		addr:    config.Setting.HEPAddr,
-		workers: config.Setting.HEPWorkers,
-		pool:    make(chan chan struct{}, runtime.NumCPU()*1e4),
+		addr:      config.Setting.HEPAddr,
+		workers:   config.Setting.HEPWorkers,
+		batchSize: batchSize,
+		sockets:   sockets,
+		pool:      make(chan chan struct{}, runtime.NumCPU()*1e4),
+		conns:     make(map[net.Conn]struct{}),
 	}
 }
 
-func (h *HEPInput) Run() {
-	udpAddr, err := net.ResolveUDPAddr("udp", h.addr)
-	if err != nil {
-		logp.Critical("%v", err)
-	}
+func (h *HEPInput) trackConn(conn net.Conn) {
+	h.connMu.Lock()
+	h.conns[conn] = struct{}{}
+	h.connMu.Unlock()
+}
 
-	conn, err := net.ListenUDP("udp", udpAddr)
-	if err != nil {
-		logp.Critical("%v", err)
-	}
+func (h *HEPInput) untrackConn(conn net.Conn) {
+	h.connMu.Lock()
+	delete(h.conns, conn)
+	h.connMu.Unlock()
+}
 
+func (h *HEPInput) Run() {
 	for n := 0; n < h.workers; n++ {
 		go func() {
 			shut := make(chan struct{})
@@ -108,27 +138,74 @@ func (h *HEPInput) Run() {
 		}()
 	}
 
-	logp.Info("hep input address: %s, workders: %d\n", h.addr, h.workers)
-	go h.logStats()
+	if config.Setting.PCAPFile != "" || config.Setting.PCAPIface != "" {
+		p := pcap.New()
+		p.Chan = make(chan []byte, 10000)
+		h.pcapInput = p
 
-	for !h.stop {
-		buf := hepBuffer.Get().([]byte)
-		conn.SetReadDeadline(time.Now().Add(1e9))
-		n, _, err := conn.ReadFrom(buf)
-		if err != nil {
-			continue
-		} else if n > 8192 {
-			logp.Warn("received to big packet with %d bytes", n)
-			atomic.AddUint64(&h.stats.ErrCount, 1)
-			continue
-		}
-		atomic.AddUint64(&h.stats.PktCount, 1)
-		inCh <- buf[:n]
+		go func() {
+			for msg := range p.Chan {
+				if len(msg) > 8192 {
+					logp.Warn("received to big packet with %d bytes", len(msg))
+					atomic.AddUint64(&h.stats.ErrCount, 1)
+					continue
+				}
+				buf := hepBuffer.Get().([]byte)
+				copy(buf, msg)
+				inCh <- buf[:len(msg)]
+			}
+		}()
+
+		go func() {
+			if err := p.Run(); err != nil {
+				logp.Err("%v", err)
+			}
+			close(p.Chan)
+		}()
+	}
+
+	if config.Setting.HEPUnixSocket != "" {
+		go h.runUnix()
+	}
+
+	if config.Setting.HEPTCPAddr != "" {
+		go h.runTCP()
 	}
+
+	if config.Setting.HEPTLSAddr != "" {
+		go h.runTLS()
+	}
+
+	logp.Info("hep input address: %s, workders: %d, batch: %d, sockets: %d\n", h.addr, h.workers, h.batchSize, h.sockets)
+	go h.logStats()
+
+	h.runUDP()
 }
 
 func (h *HEPInput) End() {
 	h.stop = true
+
+	if h.tcpListener != nil {
+		h.tcpListener.Close()
+	}
+	if h.tlsListener != nil {
+		h.tlsListener.Close()
+	}
+
+	h.connMu.Lock()
+	for conn := range h.conns {
+		conn.Close()
+	}
+	h.connMu.Unlock()
+
+	if h.unixConn != nil {
+		h.unixConn.Close()
+		os.Remove(config.Setting.HEPUnixSocket)
+	}
+	if h.pcapInput != nil {
+		h.pcapInput.End()
+	}
+
 	time.Sleep(2 * time.Second)
 	logp.Info("heplify-server has been stopped")
 	close(inCh)
@@ -225,6 +302,13 @@ func (h *HEPInput) logStats() {
 				len(dbCh),
 				len(mCh),
 			)
+
+			for i := range h.socketStats {
+				logp.Info("Socket %d packet count: %d",
+					h.socketStats[i].id,
+					atomic.SwapUint64(&h.socketStats[i].pktCount, 0),
+				)
+			}
 		}
 	}
 }
@@ -0,0 +1,86 @@
+//go:build linux
+// +build linux
+
+package input
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/sys/unix"
+
+	"github.com/negbie/heplify-server/logp"
+)
+
+func (h *HEPInput) runUDP() {
+	h.socketStats = make([]socketStat, h.sockets)
+
+	for i := 0; i < h.sockets; i++ {
+		conn, err := listenReusePort(h.addr)
+		if err != nil {
+			logp.Critical("%v", err)
+		}
+		h.socketStats[i].id = i
+		go h.recvBatch(i, conn)
+	}
+
+	for !h.stop {
+		time.Sleep(time.Second)
+	}
+}
+
+func listenReusePort(addr string) (*net.UDPConn, error) {
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		},
+	}
+
+	pc, err := lc.ListenPacket(context.Background(), "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return pc.(*net.UDPConn), nil
+}
+
+func (h *HEPInput) recvBatch(id int, conn *net.UDPConn) {
+	pc := ipv4.NewPacketConn(conn)
+	msgs := make([]ipv4.Message, h.batchSize)
+	for i := range msgs {
+		msgs[i].Buffers = [][]byte{make([]byte, 8192)}
+	}
+
+	for !h.stop {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := pc.ReadBatch(msgs, 0)
+		if err != nil {
+			continue
+		}
+
+		for i := 0; i < n; i++ {
+			size := msgs[i].N
+			if size > 8192 {
+				logp.Warn("received to big packet with %d bytes", size)
+				atomic.AddUint64(&h.stats.ErrCount, 1)
+				continue
+			}
+			buf := hepBuffer.Get().([]byte)
+			copy(buf, msgs[i].Buffers[0][:size])
+			atomic.AddUint64(&h.stats.PktCount, 1)
+			atomic.AddUint64(&h.socketStats[id].pktCount, 1)
+			inCh <- buf[:size]
+		}
+	}
+	conn.Close()
+}
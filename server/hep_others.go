@@ -0,0 +1,43 @@
+//go:build !linux
+// +build !linux
+
+package input
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/negbie/heplify-server/logp"
+)
+
+func (h *HEPInput) runUDP() {
+	udpAddr, err := net.ResolveUDPAddr("udp", h.addr)
+	if err != nil {
+		logp.Critical("%v", err)
+	}
+
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		logp.Critical("%v", err)
+	}
+
+	h.socketStats = make([]socketStat, 1)
+
+	for !h.stop {
+		buf := hepBuffer.Get().([]byte)
+		conn.SetReadDeadline(time.Now().Add(1e9))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			continue
+		} else if n > 8192 {
+			logp.Warn("received to big packet with %d bytes", n)
+			atomic.AddUint64(&h.stats.ErrCount, 1)
+			continue
+		}
+		atomic.AddUint64(&h.stats.PktCount, 1)
+		atomic.AddUint64(&h.socketStats[0].pktCount, 1)
+		inCh <- buf[:n]
+	}
+	conn.Close()
+}
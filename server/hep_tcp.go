@@ -0,0 +1,135 @@
+package input
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync/atomic"
+
+	"github.com/negbie/heplify-server"
+	"github.com/negbie/heplify-server/config"
+	"github.com/negbie/heplify-server/logp"
+)
+
+func (h *HEPInput) runTCP() {
+	ln, err := net.Listen("tcp", config.Setting.HEPTCPAddr)
+	if err != nil {
+		logp.Critical("%v", err)
+		return
+	}
+	h.tcpListener = ln
+
+	logp.Info("hep tcp input address: %s\n", config.Setting.HEPTCPAddr)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if h.stop {
+				return
+			}
+			logp.Warn("%v", err)
+			continue
+		}
+		go h.handleTCP(conn)
+	}
+}
+
+func (h *HEPInput) runTLS() {
+	cert, err := tls.LoadX509KeyPair(config.Setting.HEPTLSCert, config.Setting.HEPTLSKey)
+	if err != nil {
+		logp.Critical("%v", err)
+		return
+	}
+
+	ln, err := tls.Listen("tcp", config.Setting.HEPTLSAddr, &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		logp.Critical("%v", err)
+		return
+	}
+	h.tlsListener = ln
+
+	logp.Info("hep tls input address: %s\n", config.Setting.HEPTLSAddr)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if h.stop {
+				return
+			}
+			logp.Warn("%v", err)
+			continue
+		}
+		go h.handleTLS(conn)
+	}
+}
+
+func (h *HEPInput) handleTCP(conn net.Conn) {
+	h.trackConn(conn)
+	defer h.untrackConn(conn)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	for {
+		msg, err := readHEP3(r)
+		if err != nil {
+			return
+		}
+		atomic.AddUint64(&h.stats.PktCount, 1)
+		inCh <- msg
+	}
+}
+
+func (h *HEPInput) handleTLS(conn net.Conn) {
+	h.trackConn(conn)
+	defer h.untrackConn(conn)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	for {
+		msg, err := readHEP3(r)
+		if err != nil {
+			return
+		}
+
+		hepPkt, err := decoder.DecodeHEP(msg)
+		if err != nil {
+			atomic.AddUint64(&h.stats.ErrCount, 1)
+			hepBuffer.Put(msg[:8192])
+			continue
+		}
+		if hepPkt.NodePW != config.Setting.HEPTLSPW {
+			logp.Warn("dropped hep packet with wrong NodePW from %s", conn.RemoteAddr())
+			atomic.AddUint64(&h.stats.ErrCount, 1)
+			hepBuffer.Put(msg[:8192])
+			continue
+		}
+
+		atomic.AddUint64(&h.stats.PktCount, 1)
+		inCh <- msg
+	}
+}
+
+func readHEP3(r *bufio.Reader) ([]byte, error) {
+	header := make([]byte, 6)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[0] != 'H' || header[1] != 'E' || header[2] != 'P' || header[3] != '3' {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	length := binary.BigEndian.Uint16(header[4:6])
+	if length < 6 || length > 8192 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	buf := hepBuffer.Get().([]byte)
+	copy(buf, header)
+	if _, err := io.ReadFull(r, buf[6:length]); err != nil {
+		hepBuffer.Put(buf[:8192])
+		return nil, err
+	}
+	return buf[:length], nil
+}
@@ -0,0 +1,64 @@
+package input
+
+import (
+	"net"
+	"os"
+	"sync/atomic"
+
+	"github.com/negbie/heplify-server/config"
+	"github.com/negbie/heplify-server/logp"
+)
+
+// runUnix listens on an AF_UNIX SOCK_DGRAM socket for capture agents
+// co-located on the same host. Unix datagrams preserve message boundaries,
+// so messages are handed straight to the worker pool without reframing.
+func (h *HEPInput) runUnix() {
+	sockPath := config.Setting.HEPUnixSocket
+
+	os.Remove(sockPath)
+
+	addr, err := net.ResolveUnixAddr("unixgram", sockPath)
+	if err != nil {
+		logp.Critical("%v", err)
+		return
+	}
+
+	conn, err := net.ListenUnixgram("unixgram", addr)
+	if err != nil {
+		logp.Critical("%v", err)
+		return
+	}
+	h.unixConn = conn
+
+	if mode := config.Setting.HEPUnixSockMode; mode != 0 {
+		if err := os.Chmod(sockPath, mode); err != nil {
+			logp.Warn("%v", err)
+		}
+	}
+	if config.Setting.HEPUnixSockUID != 0 || config.Setting.HEPUnixSockGID != 0 {
+		if err := os.Chown(sockPath, config.Setting.HEPUnixSockUID, config.Setting.HEPUnixSockGID); err != nil {
+			logp.Warn("%v", err)
+		}
+	}
+
+	logp.Info("hep unix socket input address: %s\n", sockPath)
+
+	for !h.stop {
+		buf := hepBuffer.Get().([]byte)
+		n, err := conn.Read(buf)
+		if err != nil {
+			if h.stop {
+				return
+			}
+			hepBuffer.Put(buf)
+			continue
+		} else if n > 8192 {
+			logp.Warn("received to big packet with %d bytes", n)
+			atomic.AddUint64(&h.stats.ErrCount, 1)
+			hepBuffer.Put(buf)
+			continue
+		}
+		atomic.AddUint64(&h.stats.PktCount, 1)
+		inCh <- buf[:n]
+	}
+}